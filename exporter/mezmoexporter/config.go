@@ -0,0 +1,145 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package mezmoexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/mezmoexporter"
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configretry"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+
+	compressionLevelDefault         = "default"
+	compressionLevelBestSpeed       = "best_speed"
+	compressionLevelBestCompression = "best_compression"
+
+	compressionCodecStdlib    = "stdlib"
+	compressionCodecKlauspost = "klauspost"
+
+	bodyFormatRaw      = "raw"
+	bodyFormatJSON     = "json"
+	bodyFormatLogfmt   = "logfmt"
+	bodyFormatTemplate = "template"
+)
+
+// Config defines configuration for the Mezmo exporter.
+type Config struct {
+	confighttp.ClientConfig `mapstructure:",squash"`
+
+	IngestURL string              `mapstructure:"ingest_url"`
+	IngestKey configopaque.String `mapstructure:"ingest_key"`
+
+	// GzipCompression selects the content-encoding applied to outgoing
+	// batches. One of "none" or "gzip". This is deliberately a separate knob
+	// from the inherited ClientConfig.Compression: the exporter gzips
+	// batches itself (to control level and codec below), and forces
+	// ClientConfig.Compression off so confighttp never also compresses the
+	// already-compressed body.
+	GzipCompression string `mapstructure:"gzip_compression"`
+	// CompressionLevel selects the gzip compression level when
+	// GzipCompression is "gzip". One of "default", "best_speed",
+	// "best_compression".
+	CompressionLevel string `mapstructure:"compression_level"`
+	// CompressionCodec selects the gzip implementation used when
+	// GzipCompression is "gzip". One of "stdlib" (compress/gzip) or
+	// "klauspost" (github.com/klauspost/compress/gzip, faster at the cost of
+	// a vendored dependency).
+	CompressionCodec string `mapstructure:"compression_codec"`
+
+	RetryConfig configretry.BackOffConfig  `mapstructure:"retry_on_failure"`
+	QueueConfig exporterhelper.QueueConfig `mapstructure:"sending_queue"`
+
+	// MaxLinesPerBatch caps the number of log lines per outgoing request.
+	// Zero (the default) means no line-count limit; batches are still split
+	// by MaxBytesPerBatch.
+	MaxLinesPerBatch int `mapstructure:"max_lines_per_batch"`
+	// MaxBytesPerBatch caps the serialized size of a single request body.
+	MaxBytesPerBatch int `mapstructure:"max_bytes_per_batch"`
+	// MaxConcurrentRequests bounds how many batches are in flight to Mezmo
+	// at once.
+	MaxConcurrentRequests int `mapstructure:"max_concurrent_requests"`
+
+	// FlattenAttributes flattens nested meta maps/slices into dotted keys
+	// (e.g. "request.headers.0.name") instead of nested JSON objects.
+	FlattenAttributes bool `mapstructure:"flatten_attributes"`
+
+	// BodyFormat selects how the log record body is rendered into the
+	// Mezmo line text. One of "raw", "json", "logfmt", "template".
+	BodyFormat string `mapstructure:"body_format"`
+	// BodyTemplate is a text/template body, required when BodyFormat is
+	// "template". It has access to .Body, .Attributes, .Resource,
+	// .Severity, and .Timestamp.
+	BodyTemplate string `mapstructure:"body_template"`
+
+	// RequestTimeout bounds a single batch upload, independent of
+	// ClientConfig.Timeout, so pipeline shutdown or upstream deadline
+	// propagation can abort an in-flight request rather than waiting on it.
+	// Zero disables the per-request deadline.
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+}
+
+func (c *Config) Validate() error {
+	if c.IngestURL == "" {
+		return errors.New("ingest_url is required")
+	}
+	if c.IngestKey == "" {
+		return errors.New("ingest_key is required")
+	}
+
+	switch c.GzipCompression {
+	case compressionNone, compressionGzip:
+	default:
+		return errors.New("gzip_compression must be one of \"none\" or \"gzip\"")
+	}
+
+	switch c.CompressionLevel {
+	case compressionLevelDefault, compressionLevelBestSpeed, compressionLevelBestCompression:
+	default:
+		return errors.New("compression_level must be one of \"default\", \"best_speed\", or \"best_compression\"")
+	}
+
+	switch c.CompressionCodec {
+	case compressionCodecStdlib, compressionCodecKlauspost:
+	default:
+		return errors.New("compression_codec must be one of \"stdlib\" or \"klauspost\"")
+	}
+
+	if c.MaxLinesPerBatch < 0 {
+		return errors.New("max_lines_per_batch must be >= 0")
+	}
+	if c.MaxBytesPerBatch <= 0 {
+		return errors.New("max_bytes_per_batch must be > 0")
+	}
+	if c.MaxConcurrentRequests <= 0 {
+		return errors.New("max_concurrent_requests must be > 0")
+	}
+
+	switch c.BodyFormat {
+	case bodyFormatRaw, bodyFormatJSON, bodyFormatLogfmt:
+	case bodyFormatTemplate:
+		if c.BodyTemplate == "" {
+			return errors.New("body_template is required when body_format is \"template\"")
+		}
+		if _, err := template.New("body").Parse(c.BodyTemplate); err != nil {
+			return fmt.Errorf("invalid body_template: %w", err)
+		}
+	default:
+		return errors.New("body_format must be one of \"raw\", \"json\", \"logfmt\", or \"template\"")
+	}
+
+	if c.RequestTimeout < 0 {
+		return errors.New("request_timeout must be >= 0")
+	}
+
+	return nil
+}
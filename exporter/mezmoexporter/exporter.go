@@ -5,22 +5,50 @@ package mezmoexporter // import "github.com/open-telemetry/opentelemetry-collect
 
 import (
 	"bytes"
-	"compress/gzip"
+	stdgzip "compress/gzip"
 	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
+	"github.com/klauspost/compress/gzip"
+
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+const (
+	maxBodySize     = 10 * 1024 * 1024 // 10MB
+	maxMessageSize  = 64_000
+	maxAppnameLen   = 32
+	maxLogLevelLen  = 32
+	maxMetaDataSize = 4_000
+)
+
+// gzipWriter is implemented by both compress/gzip.Writer and
+// klauspost/compress/gzip.Writer, letting sendLinesToMezmo stay agnostic to
+// which codec produced the pooled writer.
+type gzipWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// bodyRenderer turns a log record's body (and its resource, for template
+// mode) into the line text sent to Mezmo.
+type bodyRenderer func(resource pcommon.Resource, log plog.LogRecord) string
+
 type mezmoExporter struct {
 	config          *Config
 	settings        component.TelemetrySettings
@@ -29,20 +57,42 @@ type mezmoExporter struct {
 	log             *zap.Logger
 	wg              sync.WaitGroup
 	bytesPool       *sync.Pool
+	gzipPool        *sync.Pool
+	renderBody      bodyRenderer
 }
 
 type mezmoLogLine struct {
-	Timestamp int64             `json:"timestamp"`
-	Line      string            `json:"line"`
-	App       string            `json:"app"`
-	Level     string            `json:"level"`
-	Meta      map[string]string `json:"meta"`
+	Timestamp int64          `json:"timestamp"`
+	Line      string         `json:"line"`
+	App       string         `json:"app"`
+	Level     string         `json:"level"`
+	Meta      map[string]any `json:"meta"`
 }
 
 type mezmoLogBody struct {
 	Lines []mezmoLogLine `json:"lines"`
 }
 
+// logEntry pairs a serialized mezmoLogLine with the resource/scope/record it
+// came from, so a batch that fails to send can be mapped back to a subset of
+// the original plog.Logs for the sending queue to persist and retry - without
+// resending lines that already succeeded.
+type logEntry struct {
+	resourceIdx int
+	scopeIdx    int
+	resource    pcommon.Resource
+	scope       pcommon.InstrumentationScope
+	record      plog.LogRecord
+	line        mezmoLogLine
+}
+
+// logBatch is one outgoing request body together with the entries it was
+// built from.
+type logBatch struct {
+	buf     *bytes.Buffer
+	entries []logEntry
+}
+
 func newLogsExporter(config *Config, settings component.TelemetrySettings, buildInfo component.BuildInfo, logger *zap.Logger) *mezmoExporter {
 	var e = &mezmoExporter{
 		config:          config,
@@ -55,18 +105,57 @@ func newLogsExporter(config *Config, settings component.TelemetrySettings, build
 			},
 		},
 	}
+	e.gzipPool = &sync.Pool{
+		New: func() any {
+			return e.newGzipWriter()
+		},
+	}
 	return e
 }
 
-func (m *mezmoExporter) pushLogData(_ context.Context, ld plog.Logs) error {
+// newGzipWriter builds a gzip writer at the configured level using either the
+// standard library or klauspost/compress, per config.CompressionCodec. The
+// returned writer is unusable until Reset is called with a destination.
+func (m *mezmoExporter) newGzipWriter() gzipWriter {
+	level := gzipLevel(m.config.CompressionLevel)
+	if m.config.CompressionCodec == compressionCodecKlauspost {
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	}
+	w, _ := stdgzip.NewWriterLevel(io.Discard, level)
+	return w
+}
+
+func gzipLevel(level string) int {
+	switch level {
+	case compressionLevelBestSpeed:
+		return stdgzip.BestSpeed
+	case compressionLevelBestCompression:
+		return stdgzip.BestCompression
+	default:
+		return stdgzip.DefaultCompression
+	}
+}
+
+func (m *mezmoExporter) pushLogData(ctx context.Context, ld plog.Logs) error {
 	m.wg.Add(1)
 	defer m.wg.Done()
 
-	return m.logDataToMezmo(ld)
+	return m.logDataToMezmo(ctx, ld)
 }
 
 func (m *mezmoExporter) start(ctx context.Context, host component.Host) (err error) {
+	// The exporter gzips batches itself in sendLinesToMezmo (to control
+	// level and codec); force off confighttp's own compressing
+	// RoundTripper so it never also compresses an already-compressed body.
+	m.config.ClientConfig.Compression = ""
+
 	m.client, err = m.config.ClientConfig.ToClientContext(ctx, host, m.settings)
+	if err != nil {
+		return err
+	}
+
+	m.renderBody, err = newBodyRenderer(m.config)
 	return err
 }
 
@@ -80,10 +169,19 @@ func (m *mezmoExporter) stop(context.Context) (err error) {
 	return nil
 }
 
-func (m *mezmoExporter) logDataToMezmo(ld plog.Logs) error {
-	var errs error
+func (m *mezmoExporter) logDataToMezmo(ctx context.Context, ld plog.Logs) error {
+	entries := m.buildLogEntries(ld)
+
+	batches, err := m.buildBatches(entries)
+	if err != nil {
+		return err
+	}
 
-	var lines []mezmoLogLine
+	return m.sendBatches(ctx, batches)
+}
+
+func (m *mezmoExporter) buildLogEntries(ld plog.Logs) []logEntry {
+	var entries []logEntry
 
 	// Convert the log resources to mezmo lines...
 	resourceLogs := ld.ResourceLogs()
@@ -93,13 +191,14 @@ func (m *mezmoExporter) logDataToMezmo(ld plog.Logs) error {
 		scopeLogs := resourceLogs.At(i).ScopeLogs()
 
 		for j := 0; j < scopeLogs.Len(); j++ {
+			scope := scopeLogs.At(j).Scope()
 			logs := scopeLogs.At(j).LogRecords()
 
 			for k := 0; k < logs.Len(); k++ {
 				log := logs.At(k)
 
 				// Convert Attributes to meta fields being mindful of the maxMetaDataSize restriction
-				attrs := map[string]string{}
+				attrs := map[string]any{}
 				if hasResourceHostName {
 					attrs["hostname"] = resourceHostName.AsString()
 				}
@@ -113,10 +212,14 @@ func (m *mezmoExporter) logDataToMezmo(ld plog.Logs) error {
 				}
 
 				log.Attributes().Range(func(k string, v pcommon.Value) bool {
-					attrs[k] = truncateString(v.Str(), maxMetaDataSize)
+					attrs[k] = capMetaValue(valueToAny(v), maxMetaDataSize)
 					return true
 				})
 
+				if m.config.FlattenAttributes {
+					attrs = flattenMeta(attrs)
+				}
+
 				s, _ := log.Attributes().Get("appname")
 				app := s.Str()
 
@@ -132,71 +235,189 @@ func (m *mezmoExporter) logDataToMezmo(ld plog.Logs) error {
 
 				line := mezmoLogLine{
 					Timestamp: tstamp,
-					Line:      truncateString(log.Body().Str(), maxMessageSize),
+					Line:      truncateString(m.renderBody(resource, log), maxMessageSize),
 					App:       truncateString(app, maxAppnameLen),
 					Level:     logLevel,
 					Meta:      attrs,
 				}
-				lines = append(lines, line)
+				entries = append(entries, logEntry{
+					resourceIdx: i,
+					scopeIdx:    j,
+					resource:    resource,
+					scope:       scope,
+					record:      log,
+					line:        line,
+				})
 			}
 		}
 	}
 
-	// Send them to Mezmo in batches < 10MB in size
+	return entries
+}
+
+// buildBatches serializes entries into one or more JSON request bodies, each
+// kept under config.MaxBytesPerBatch and config.MaxLinesPerBatch (when set).
+// A single line that alone exceeds MaxBytesPerBatch is sent in a batch of its
+// own, whose body is then larger than the limit. The returned buffers come from m.bytesPool and are the caller's
+// responsibility to return. Each batch retains the entries it was built
+// from so a failed send can be mapped back to the originating log records.
+func (m *mezmoExporter) buildBatches(entries []logEntry) ([]logBatch, error) {
+	var batches []logBatch
+
 	b := m.bytesPool.Get().(*bytes.Buffer)
-	defer m.bytesPool.Put(b)
 	b.Reset()
 	b.WriteString("{\"lines\": [")
+	var batchEntries []logEntry
+
+	startNewBatch := func() {
+		b.WriteString("]}")
+		batches = append(batches, logBatch{buf: b, entries: batchEntries})
+		b = m.bytesPool.Get().(*bytes.Buffer)
+		b.Reset()
+		b.WriteString("{\"lines\": [")
+		batchEntries = nil
+	}
 
-	var lineBytes []byte
-	for i, line := range lines {
-		if i > 0 {
-			b.WriteRune(',')
+	for _, e := range entries {
+		lineBytes, err := json.Marshal(e.line)
+		if err != nil {
+			return nil, fmt.Errorf("error Creating JSON payload: %w", err)
+		}
+
+		lineCount := len(batchEntries)
+		separator := 0
+		if lineCount > 0 {
+			separator = 1 // the comma written between lines
 		}
-		if lineBytes, errs = json.Marshal(line); errs != nil {
-			return fmt.Errorf("error Creating JSON payload: %w", errs)
+		atLineLimit := m.config.MaxLinesPerBatch > 0 && lineCount >= m.config.MaxLinesPerBatch
+		atByteLimit := lineCount > 0 && b.Len()+separator+len(lineBytes) >= m.config.MaxBytesPerBatch-2
+		if lineCount > 0 && (atLineLimit || atByteLimit) {
+			startNewBatch()
 		}
 
-		var newBufSize = b.Len() + len(lineBytes)
-		if newBufSize >= maxBodySize-2 {
-			b.WriteString("]}")
+		if len(batchEntries) > 0 {
+			b.WriteRune(',')
+		}
+		b.Write(lineBytes)
+		batchEntries = append(batchEntries, e)
+	}
+
+	b.WriteString("]}")
+	batches = append(batches, logBatch{buf: b, entries: batchEntries})
+
+	return batches, nil
+}
 
-			if errs = m.sendLinesToMezmo(b); errs != nil {
-				return errs
+// sendBatches dispatches batches to Mezmo concurrently, bounded by
+// config.MaxConcurrentRequests. If any batch fails, the returned error wraps
+// only the log records belonging to the failed batches (via
+// consumererror.NewLogs) so the sending queue persists and replays just
+// those records instead of the whole input, which would otherwise resend
+// lines that already succeeded.
+func (m *mezmoExporter) sendBatches(ctx context.Context, batches []logBatch) error {
+	sem := make(chan struct{}, m.config.MaxConcurrentRequests)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs error
+	var failed []logBatch
+
+	for _, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(batch logBatch) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer m.bytesPool.Put(batch.buf)
+
+			if err := m.sendLinesToMezmo(ctx, batch.buf); err != nil {
+				mu.Lock()
+				errs = multierr.Append(errs, err)
+				failed = append(failed, batch)
+				mu.Unlock()
 			}
-			b.Reset()
-			b.WriteString("{\"lines\": [")
-		}
+		}(batch)
+	}
 
-		b.Write(lineBytes)
+	wg.Wait()
 
+	if errs == nil {
+		return nil
 	}
+	return consumererror.NewLogs(errs, failedLogs(failed))
+}
 
-	b.WriteString("]}")
-	return m.sendLinesToMezmo(b)
+// failedLogs reconstructs a plog.Logs containing only the records that fed
+// the given batches, preserving their original resource/scope grouping so
+// the sending queue replays an equivalent (not merely equal-sized) subset.
+func failedLogs(batches []logBatch) plog.Logs {
+	out := plog.NewLogs()
+
+	type scopeKey struct{ resourceIdx, scopeIdx int }
+	resourceLogsByIdx := map[int]plog.ResourceLogs{}
+	scopeLogsByKey := map[scopeKey]plog.ScopeLogs{}
+
+	for _, batch := range batches {
+		for _, e := range batch.entries {
+			rl, ok := resourceLogsByIdx[e.resourceIdx]
+			if !ok {
+				rl = out.ResourceLogs().AppendEmpty()
+				e.resource.CopyTo(rl.Resource())
+				resourceLogsByIdx[e.resourceIdx] = rl
+			}
+
+			key := scopeKey{e.resourceIdx, e.scopeIdx}
+			sl, ok := scopeLogsByKey[key]
+			if !ok {
+				sl = rl.ScopeLogs().AppendEmpty()
+				e.scope.CopyTo(sl.Scope())
+				scopeLogsByKey[key] = sl
+			}
+
+			e.record.CopyTo(sl.LogRecords().AppendEmpty())
+		}
+	}
+
+	return out
 }
 
-func (m *mezmoExporter) sendLinesToMezmo(b *bytes.Buffer) (errs error) {
+func (m *mezmoExporter) sendLinesToMezmo(ctx context.Context, b *bytes.Buffer) (errs error) {
 	var r io.Reader
-	if m.config.Compression {
+	if m.config.GzipCompression == compressionGzip {
 		buf := m.bytesPool.Get().(*bytes.Buffer)
 		defer m.bytesPool.Put(buf)
 		buf.Reset()
-		w := gzip.NewWriter(buf)
+
+		w := m.gzipPool.Get().(gzipWriter)
+		defer m.gzipPool.Put(w)
+		w.Reset(buf)
+
 		if _, err := w.Write(b.Bytes()); err != nil {
 			return fmt.Errorf("failed to compress log data: %w", err)
 		}
-		_ = w.Close()
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress log data: %w", err)
+		}
 		r = buf
 	} else {
 		r = b
 	}
-	req, _ := http.NewRequest("POST", m.config.IngestURL, r)
+
+	if m.config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.config.RequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.config.IngestURL, r)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("User-Agent", m.userAgentString)
 	req.Header.Add("apikey", string(m.config.IngestKey))
-	if m.config.Compression {
+	if m.config.GzipCompression == compressionGzip {
 		req.Header.Add("Content-Encoding", "gzip")
 	}
 
@@ -204,13 +425,243 @@ func (m *mezmoExporter) sendLinesToMezmo(b *bytes.Buffer) (errs error) {
 	if res, errs = m.client.Do(req); errs != nil {
 		return fmt.Errorf("failed to POST log to Mezmo: %w", errs)
 	}
+	defer res.Body.Close()
+
 	if res.StatusCode >= 400 {
 		m.log.Error(fmt.Sprintf("got http status (%s): %s", req.URL.Path, res.Status))
 		if checkLevel := m.log.Check(zap.DebugLevel, "http response"); checkLevel != nil {
 			responseBody, _ := io.ReadAll(res.Body)
 			checkLevel.Write(zap.String("response", string(responseBody)))
 		}
+		return classifyResponseError(res)
+	}
+
+	return nil
+}
+
+// classifyResponseError turns a non-2xx Mezmo response into an error the
+// exporterhelper retry queue knows how to act on: 429 and 5xx are transient
+// (honoring Retry-After when Mezmo sends one), everything else is permanent
+// since retrying won't change the outcome.
+func classifyResponseError(res *http.Response) error {
+	err := fmt.Errorf("got http status (%s): %s", res.Request.URL.Path, res.Status)
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return exporterhelper.NewThrottleRetry(err, retryAfter)
+		}
+		return err
+	}
+
+	return consumererror.NewPermanent(err)
+}
+
+// parseRetryAfter parses the Retry-After header, which per RFC 9110 is
+// either a number of seconds or an HTTP date. Only the seconds form is
+// supported; ok is false if the header is absent or malformed.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// newBodyRenderer builds the bodyRenderer for config.BodyFormat once, so
+// per-record conversion never has to branch on the configured mode.
+func newBodyRenderer(cfg *Config) (bodyRenderer, error) {
+	switch cfg.BodyFormat {
+	case bodyFormatJSON:
+		return renderBodyJSON, nil
+	case bodyFormatLogfmt:
+		return renderBodyLogfmt, nil
+	case bodyFormatTemplate:
+		tmpl, err := template.New("body").Parse(cfg.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body_template: %w", err)
+		}
+		return func(resource pcommon.Resource, log plog.LogRecord) string {
+			return renderBodyTemplate(tmpl, resource, log)
+		}, nil
+	default:
+		return renderBodyRaw, nil
+	}
+}
+
+func renderBodyRaw(_ pcommon.Resource, log plog.LogRecord) string {
+	return log.Body().Str()
+}
+
+// renderBodyJSON serializes Map/Slice bodies back out as JSON instead of
+// collapsing them to "" the way Body().Str() does; scalar bodies render via
+// AsString() so non-string types (int, bool, double) aren't dropped either.
+func renderBodyJSON(_ pcommon.Resource, log plog.LogRecord) string {
+	body := log.Body()
+	switch body.Type() {
+	case pcommon.ValueTypeMap, pcommon.ValueTypeSlice:
+		b, err := json.Marshal(valueToAny(body))
+		if err != nil {
+			return body.AsString()
+		}
+		return string(b)
+	default:
+		return body.AsString()
+	}
+}
+
+// renderBodyLogfmt renders the body's Map fields (or the raw body under a
+// "msg" key) followed by the record's attributes, all as key=value pairs.
+func renderBodyLogfmt(_ pcommon.Resource, log plog.LogRecord) string {
+	var pairs []string
+
+	if log.Body().Type() == pcommon.ValueTypeMap {
+		log.Body().Map().Range(func(k string, v pcommon.Value) bool {
+			pairs = append(pairs, logfmtPair(k, v))
+			return true
+		})
+	} else if body := log.Body().AsString(); body != "" {
+		pairs = append(pairs, "msg="+logfmtQuote(body))
+	}
+
+	log.Attributes().Range(func(k string, v pcommon.Value) bool {
+		pairs = append(pairs, logfmtPair(k, v))
+		return true
+	})
+
+	return strings.Join(pairs, " ")
+}
+
+func logfmtPair(key string, v pcommon.Value) string {
+	return key + "=" + logfmtQuote(v.AsString())
+}
+
+func logfmtQuote(s string) string {
+	if strings.ContainsAny(s, " \t\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+type bodyTemplateData struct {
+	Body       any
+	Attributes map[string]any
+	Resource   map[string]any
+	Severity   string
+	Timestamp  time.Time
+}
+
+// renderBodyTemplate executes the user-provided template against the body,
+// attributes, resource, severity, and timestamp of a single log record.
+func renderBodyTemplate(tmpl *template.Template, resource pcommon.Resource, log plog.LogRecord) string {
+	data := bodyTemplateData{
+		Body:       valueToAny(log.Body()),
+		Attributes: mapToAny(log.Attributes()),
+		Resource:   mapToAny(resource.Attributes()),
+		Severity:   log.SeverityText(),
+		Timestamp:  log.Timestamp().AsTime(),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return log.Body().Str()
+	}
+	return buf.String()
+}
+
+func mapToAny(attrs pcommon.Map) map[string]any {
+	m := make(map[string]any, attrs.Len())
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		m[k] = valueToAny(v)
+		return true
+	})
+	return m
+}
+
+// valueToAny converts a pcommon.Value to its plain-Go-type equivalent,
+// recursing into maps and slices so nested attribute structure survives into
+// the Mezmo meta field as real JSON instead of being flattened to a string.
+func valueToAny(v pcommon.Value) any {
+	switch v.Type() {
+	case pcommon.ValueTypeMap:
+		m := make(map[string]any, v.Map().Len())
+		v.Map().Range(func(k string, val pcommon.Value) bool {
+			m[k] = valueToAny(val)
+			return true
+		})
+		return m
+	case pcommon.ValueTypeSlice:
+		s := make([]any, 0, v.Slice().Len())
+		for i := 0; i < v.Slice().Len(); i++ {
+			s = append(s, valueToAny(v.Slice().At(i)))
+		}
+		return s
+	case pcommon.ValueTypeBool:
+		return v.Bool()
+	case pcommon.ValueTypeInt:
+		return v.Int()
+	case pcommon.ValueTypeDouble:
+		return v.Double()
+	case pcommon.ValueTypeBytes:
+		return v.Bytes().AsRaw()
+	case pcommon.ValueTypeEmpty:
+		return nil
+	default:
+		return v.Str()
+	}
+}
+
+// capMetaValue enforces maxMetaDataSize on the serialized form of a meta
+// value. Structured values that are too large are demoted to a truncated
+// JSON string rather than dropped, so the cap never loses the whole field.
+func capMetaValue(v any, maxBytes int) any {
+	b, err := json.Marshal(v)
+	if err != nil || len(b) <= maxBytes {
+		return v
+	}
+	return truncateString(string(b), maxBytes)
+}
+
+// flattenMeta rewrites a meta map so nested maps and slices become dotted
+// keys (e.g. "request.headers.0.name") instead of nested JSON objects, for
+// users whose downstream tooling expects flat key/value pairs.
+func flattenMeta(attrs map[string]any) map[string]any {
+	flat := make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		flattenValue(k, v, flat)
+	}
+	return flat
+}
+
+func flattenValue(prefix string, v any, out map[string]any) {
+	switch vv := v.(type) {
+	case map[string]any:
+		if len(vv) == 0 {
+			out[prefix] = vv
+			return
+		}
+		for k, val := range vv {
+			flattenValue(prefix+"."+k, val, out)
+		}
+	case []any:
+		if len(vv) == 0 {
+			out[prefix] = vv
+			return
+		}
+		for i, val := range vv {
+			flattenValue(fmt.Sprintf("%s.%d", prefix, i), val, out)
+		}
+	default:
+		out[prefix] = vv
 	}
+}
 
-	return res.Body.Close()
+// truncateString truncates str to at most length bytes.
+func truncateString(str string, length int) string {
+	if len(str) <= length {
+		return str
+	}
+	return str[:length]
 }
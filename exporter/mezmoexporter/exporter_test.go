@@ -0,0 +1,341 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package mezmoexporter
+
+import (
+	stdgzip "compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+)
+
+func newTestExporter(t *testing.T, mutate func(*Config)) *mezmoExporter {
+	t.Helper()
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.IngestURL = "https://example.invalid/ingest"
+	cfg.IngestKey = "test-key"
+	if mutate != nil {
+		mutate(cfg)
+	}
+
+	return newLogsExporter(cfg, component.TelemetrySettings{Logger: zap.NewNop()}, component.BuildInfo{Version: "test"}, zap.NewNop())
+}
+
+func makeEntries(n, lineLen int) []logEntry {
+	entries := make([]logEntry, n)
+	for i := range entries {
+		entries[i] = logEntry{
+			line: mezmoLogLine{
+				Timestamp: int64(i),
+				Line:      strings.Repeat("x", lineLen),
+				App:       "app",
+				Level:     "info",
+				Meta:      map[string]any{},
+			},
+		}
+	}
+	return entries
+}
+
+func TestBuildBatches_LineLimit(t *testing.T) {
+	m := newTestExporter(t, func(c *Config) {
+		c.MaxLinesPerBatch = 3
+		c.MaxBytesPerBatch = maxBodySize
+	})
+
+	batches, err := m.buildBatches(makeEntries(7, 10))
+	require.NoError(t, err)
+	require.Len(t, batches, 3)
+	assert.Len(t, batches[0].entries, 3)
+	assert.Len(t, batches[1].entries, 3)
+	assert.Len(t, batches[2].entries, 1)
+}
+
+func TestBuildBatches_ByteLimit(t *testing.T) {
+	m := newTestExporter(t, func(c *Config) {
+		c.MaxBytesPerBatch = 200
+		c.MaxLinesPerBatch = 0
+	})
+
+	batches, err := m.buildBatches(makeEntries(20, 20))
+	require.NoError(t, err)
+	require.NotEmpty(t, batches)
+
+	var total int
+	for _, b := range batches {
+		assert.LessOrEqual(t, b.buf.Len(), m.config.MaxBytesPerBatch, "no batch should exceed MaxBytesPerBatch")
+		total += len(b.entries)
+	}
+	assert.Equal(t, 20, total, "every entry must end up in exactly one batch")
+}
+
+func TestBuildBatches_SingleOversizedLineStillShipsAlone(t *testing.T) {
+	// A single line larger than MaxBytesPerBatch must still be sent on its
+	// own rather than being dropped or looping forever.
+	m := newTestExporter(t, func(c *Config) {
+		c.MaxBytesPerBatch = 10
+		c.MaxLinesPerBatch = 0
+	})
+
+	batches, err := m.buildBatches(makeEntries(1, 100))
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0].entries, 1)
+}
+
+// TestStart_ForcesOffClientConfigCompression guards against double-gzipping:
+// GzipCompression and the inherited ClientConfig.Compression both bind from
+// mapstructure independently, so start() must force the latter off or
+// confighttp would wrap the transport with its own compressing
+// RoundTripper on top of the exporter's manual gzip step.
+func TestStart_ForcesOffClientConfigCompression(t *testing.T) {
+	m := newTestExporter(t, func(c *Config) {
+		c.ClientConfig.Compression = configcompression.TypeGzip
+	})
+
+	require.NoError(t, m.start(context.Background(), componenttest.NewNopHost()))
+	assert.Empty(t, m.config.ClientConfig.Compression)
+}
+
+func TestGzipLevel(t *testing.T) {
+	cases := []struct {
+		name  string
+		level string
+		want  int
+	}{
+		{"best speed", compressionLevelBestSpeed, stdgzip.BestSpeed},
+		{"best compression", compressionLevelBestCompression, stdgzip.BestCompression},
+		{"default", compressionLevelDefault, stdgzip.DefaultCompression},
+		{"unknown falls back to default", "bogus", stdgzip.DefaultCompression},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, gzipLevel(tc.level))
+		})
+	}
+}
+
+func TestNewGzipWriter_CodecSelection(t *testing.T) {
+	stdExp := newTestExporter(t, func(c *Config) { c.CompressionCodec = compressionCodecStdlib })
+	klExp := newTestExporter(t, func(c *Config) { c.CompressionCodec = compressionCodecKlauspost })
+
+	_, stdOK := stdExp.newGzipWriter().(*stdgzip.Writer)
+	assert.True(t, stdOK, "stdlib codec should produce a *compress/gzip.Writer")
+
+	_, klOK := klExp.newGzipWriter().(*gzip.Writer)
+	assert.True(t, klOK, "klauspost codec should produce a *klauspost/compress/gzip.Writer")
+}
+
+func newTestResponse(status int, headers map[string]string) *http.Response {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.invalid/ingest", nil)
+	h := http.Header{}
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Request:    req,
+		Header:     h,
+	}
+}
+
+func TestClassifyResponseError(t *testing.T) {
+	t.Run("429 is not permanent", func(t *testing.T) {
+		err := classifyResponseError(newTestResponse(http.StatusTooManyRequests, nil))
+		require.Error(t, err)
+		assert.False(t, consumererror.IsPermanent(err))
+	})
+
+	t.Run("5xx is not permanent", func(t *testing.T) {
+		err := classifyResponseError(newTestResponse(http.StatusInternalServerError, nil))
+		require.Error(t, err)
+		assert.False(t, consumererror.IsPermanent(err))
+	})
+
+	t.Run("4xx other than 429 is permanent", func(t *testing.T) {
+		err := classifyResponseError(newTestResponse(http.StatusBadRequest, nil))
+		require.Error(t, err)
+		assert.True(t, consumererror.IsPermanent(err))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		wantOK bool
+		want   time.Duration
+	}{
+		{"absent", "", false, 0},
+		{"valid seconds", "5", true, 5 * time.Second},
+		{"zero seconds", "0", true, 0},
+		{"negative is invalid", "-1", false, 0},
+		{"http-date form is unsupported", "Wed, 21 Oct 2026 07:28:00 GMT", false, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tc.header)
+			assert.Equal(t, tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestValueToAny(t *testing.T) {
+	m := pcommon.NewMap()
+	m.PutStr("name", "svc")
+	m.PutInt("count", 3)
+	m.PutBool("ok", true)
+	m.PutDouble("ratio", 1.5)
+
+	v := pcommon.NewValueMap()
+	m.CopyTo(v.Map())
+
+	assert.Equal(t, map[string]any{
+		"name":  "svc",
+		"count": int64(3),
+		"ok":    true,
+		"ratio": 1.5,
+	}, valueToAny(v))
+}
+
+func TestValueToAny_Slice(t *testing.T) {
+	v := pcommon.NewValueSlice()
+	v.Slice().AppendEmpty().SetStr("a")
+	v.Slice().AppendEmpty().SetInt(2)
+
+	assert.Equal(t, []any{"a", int64(2)}, valueToAny(v))
+}
+
+func TestCapMetaValue(t *testing.T) {
+	small := map[string]any{"a": "b"}
+	assert.Equal(t, small, capMetaValue(small, 1000))
+
+	big := map[string]any{"a": strings.Repeat("x", 100)}
+	got := capMetaValue(big, 10)
+	s, ok := got.(string)
+	require.True(t, ok, "oversized structured values should be demoted to a string")
+	assert.LessOrEqual(t, len(s), 10)
+}
+
+func TestFlattenMeta(t *testing.T) {
+	attrs := map[string]any{
+		"request": map[string]any{
+			"headers": []any{
+				map[string]any{"name": "x-id"},
+			},
+		},
+		"status": int64(200),
+	}
+
+	got := flattenMeta(attrs)
+	assert.Equal(t, "x-id", got["request.headers.0.name"])
+	assert.Equal(t, int64(200), got["status"])
+}
+
+func TestRenderBodyJSON(t *testing.T) {
+	log := plog.NewLogRecord()
+	log.Body().SetEmptyMap()
+	log.Body().Map().PutStr("k", "v")
+
+	assert.JSONEq(t, `{"k":"v"}`, renderBodyJSON(pcommon.NewResource(), log))
+}
+
+func TestRenderBodyJSON_ScalarNonStringBody(t *testing.T) {
+	intLog := plog.NewLogRecord()
+	intLog.Body().SetInt(42)
+	assert.Equal(t, "42", renderBodyJSON(pcommon.NewResource(), intLog))
+
+	boolLog := plog.NewLogRecord()
+	boolLog.Body().SetBool(true)
+	assert.Equal(t, "true", renderBodyJSON(pcommon.NewResource(), boolLog))
+}
+
+func TestRenderBodyLogfmt(t *testing.T) {
+	log := plog.NewLogRecord()
+	log.Body().SetEmptyMap()
+	log.Body().Map().PutStr("msg", "hello world")
+	log.Attributes().PutStr("service", "api")
+
+	got := renderBodyLogfmt(pcommon.NewResource(), log)
+	assert.Contains(t, got, `msg="hello world"`)
+	assert.Contains(t, got, "service=api")
+}
+
+func TestRenderBodyTemplate(t *testing.T) {
+	tmpl, err := template.New("body").Parse("{{.Severity}}: {{.Attributes.service}}")
+	require.NoError(t, err)
+
+	log := plog.NewLogRecord()
+	log.SetSeverityText("ERROR")
+	log.Attributes().PutStr("service", "api")
+
+	assert.Equal(t, "ERROR: api", renderBodyTemplate(tmpl, pcommon.NewResource(), log))
+}
+
+// TestPushLogData_PartialFailureReportsOnlyFailedRecords exercises the full
+// pushLogData path and guards against regressing back to resending records
+// that already succeeded: with two lines split into two batches and only
+// one batch failing, the returned consumererror.Logs must carry just the
+// failing record.
+func TestPushLogData_PartialFailureReportsOnlyFailedRecords(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail-me") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	m := newTestExporter(t, func(c *Config) {
+		c.IngestURL = srv.URL
+		c.GzipCompression = compressionNone
+		c.MaxLinesPerBatch = 1
+		c.MaxConcurrentRequests = 2
+	})
+	m.client = srv.Client()
+	m.renderBody = renderBodyRaw
+
+	ld := plog.NewLogs()
+	sl := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty()
+
+	ok := sl.LogRecords().AppendEmpty()
+	ok.Body().SetStr("ok-line")
+
+	bad := sl.LogRecords().AppendEmpty()
+	bad.Body().SetStr("fail-me")
+
+	err := m.pushLogData(context.Background(), ld)
+	require.Error(t, err)
+
+	var logsErr consumererror.Logs
+	require.ErrorAs(t, err, &logsErr)
+
+	failed := logsErr.Data()
+	require.Equal(t, 1, failed.LogRecordCount())
+	assert.Equal(t, "fail-me", failed.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+}
@@ -0,0 +1,62 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package mezmoexporter // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/mezmoexporter"
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configretry"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+)
+
+const typeStr = "mezmo"
+
+// NewFactory creates a factory for the Mezmo exporter.
+func NewFactory() exporter.Factory {
+	return exporter.NewFactory(
+		component.MustNewType(typeStr),
+		createDefaultConfig,
+		exporter.WithLogs(createLogsExporter, component.StabilityLevelBeta),
+	)
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		ClientConfig:          confighttp.NewDefaultClientConfig(),
+		IngestURL:             "https://logs.mezmo.com/otel/ingest/rest",
+		GzipCompression:       compressionGzip,
+		CompressionLevel:      compressionLevelDefault,
+		CompressionCodec:      compressionCodecStdlib,
+		RetryConfig:           configretry.NewDefaultBackOffConfig(),
+		QueueConfig:           exporterhelper.NewDefaultQueueConfig(),
+		MaxBytesPerBatch:      maxBodySize,
+		MaxConcurrentRequests: 10,
+		BodyFormat:            bodyFormatRaw,
+		RequestTimeout:        30 * time.Second,
+	}
+}
+
+func createLogsExporter(
+	ctx context.Context,
+	set exporter.Settings,
+	cfg component.Config,
+) (exporter.Logs, error) {
+	config := cfg.(*Config)
+	exp := newLogsExporter(config, set.TelemetrySettings, set.BuildInfo, set.Logger)
+
+	return exporterhelper.NewLogsExporter(
+		ctx,
+		set,
+		cfg,
+		exp.pushLogData,
+		exporterhelper.WithStart(exp.start),
+		exporterhelper.WithShutdown(exp.stop),
+		exporterhelper.WithRetry(config.RetryConfig),
+		exporterhelper.WithQueue(config.QueueConfig),
+	)
+}